@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import "sync"
+
+// AppEntry represents one entry (running app or pinned shortcut) tracked by
+// the dock Manager. Only the fields and dbusutil-style property accessors
+// touched by the scratch-file/sandbox code paths are declared here.
+type AppEntry struct {
+	Id       string
+	IsDocked bool
+
+	// SandboxProfile names the profile (see SandboxProfile) used to launch
+	// this entry through bwrap, or "" if it runs unconfined.
+	SandboxProfile string
+	// IsSandboxed mirrors SandboxProfile != "", exported separately so
+	// clients can watch confinement state without string-comparing.
+	IsSandboxed bool
+
+	PropsMu sync.RWMutex
+
+	appInfo *AppInfo
+	current *WindowInfo
+	innerId string
+}
+
+func (e *AppEntry) setPropIsDocked(v bool) {
+	if e.IsDocked == v {
+		return
+	}
+	e.IsDocked = v
+}
+
+func (e *AppEntry) setPropIsSandboxed(v bool) {
+	if e.IsSandboxed == v {
+		return
+	}
+	e.IsSandboxed = v
+}
+
+func (e *AppEntry) setPropSandboxProfile(v string) {
+	if e.SandboxProfile == v {
+		return
+	}
+	e.SandboxProfile = v
+}
@@ -0,0 +1,195 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+)
+
+// auditLogMaxSize is the size threshold, in bytes, at which the audit log is
+// rotated to a .1 suffix.
+const auditLogMaxSize = 10 * 1024 * 1024 // 10MiB
+
+// userStateDir resolves $XDG_STATE_HOME, falling back to ~/.local/state per
+// the XDG base directory spec (go-lib's basedir helper predates XDG_STATE_HOME).
+func userStateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join("/tmp", ".local/state")
+	}
+	return filepath.Join(home, ".local/state")
+}
+
+func auditLogPath() string {
+	return filepath.Join(userStateDir(), "deepin/dde-daemon/dock-audit.log")
+}
+
+// AuditRecord is one JSON-lines entry in the dock audit log.
+type AuditRecord struct {
+	Timestamp   int64  `json:"timestamp"`
+	Uid         uint32 `json:"uid"`
+	Action      string `json:"action"`
+	AppId       string `json:"appId"`
+	DesktopPath string `json:"desktopPath"`
+	Sha256      string `json:"sha256"`
+	Result      string `json:"result"`
+	Error       string `json:"error,omitempty"`
+}
+
+type auditLogger struct {
+	mu   sync.Mutex
+	path string
+}
+
+var dockAuditLogger = &auditLogger{path: auditLogPath()}
+
+func sha256OfFile(path string) string {
+	if path == "" {
+		return ""
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// record appends one audit entry, rotating the log first if it has grown
+// past auditLogMaxSize.
+func (l *auditLogger) record(rec AuditRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.rotateIfNeeded(); err != nil {
+		logger.Warning("dock audit log: rotate failed:", err)
+	}
+
+	// #nosec G301
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		logger.Warning("dock audit log: mkdir failed:", err)
+		return
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.Warning("dock audit log: open failed:", err)
+		return
+	}
+	defer f.Close()
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		logger.Warning("dock audit log: marshal failed:", err)
+		return
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		logger.Warning("dock audit log: write failed:", err)
+	}
+}
+
+func (l *auditLogger) rotateIfNeeded() error {
+	info, err := os.Stat(l.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() < auditLogMaxSize {
+		return nil
+	}
+	return os.Rename(l.path, l.path+".1")
+}
+
+func (l *auditLogger) query(since int64, filter string) ([]AuditRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var records []AuditRecord
+	for _, path := range []string{l.path + ".1", l.path} {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec AuditRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				continue
+			}
+			if rec.Timestamp < since {
+				continue
+			}
+			if filter != "" && !strings.Contains(rec.AppId, filter) && !strings.Contains(rec.Action, filter) {
+				continue
+			}
+			records = append(records, rec)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func auditUid() uint32 {
+	return uint32(os.Getuid())
+}
+
+func logAuditRecord(action, appId, desktopPath string, result error) {
+	logAuditRecordWithHash(action, appId, desktopPath, sha256OfFile(desktopPath), result)
+}
+
+// logAuditRecordWithHash is the logAuditRecord variant for callers that
+// already have (or must compute) the desktop file's sha256 themselves,
+// notably anywhere the file is about to be or has already been deleted:
+// sha256OfFile can't read it back at record time.
+func logAuditRecordWithHash(action, appId, desktopPath, sha256 string, result error) {
+	rec := AuditRecord{
+		Timestamp:   time.Now().Unix(),
+		Uid:         auditUid(),
+		Action:      action,
+		AppId:       appId,
+		DesktopPath: desktopPath,
+		Sha256:      sha256,
+		Result:      "ok",
+	}
+	if result != nil {
+		rec.Result = "error"
+		rec.Error = result.Error()
+	}
+	dockAuditLogger.record(rec)
+}
+
+// QueryAuditLog returns the audit records recorded at or after since (a unix
+// timestamp) whose appId or action contains filter (filter == "" matches
+// everything).
+func (m *Manager) QueryAuditLog(since int64, filter string) ([]AuditRecord, *dbus.Error) {
+	records, err := dockAuditLogger.query(since, filter)
+	if err != nil {
+		return nil, dbusutil.ToError(err)
+	}
+	return records, nil
+}
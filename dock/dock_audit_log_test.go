@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLoggerRecordAndQuery(t *testing.T) {
+	l := &auditLogger{path: filepath.Join(t.TempDir(), "dock-audit.log")}
+
+	l.record(AuditRecord{Timestamp: 100, Action: "dockEntry", AppId: "firefox"})
+	l.record(AuditRecord{Timestamp: 200, Action: "undockEntry", AppId: "gimp"})
+
+	records, err := l.query(0, "")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+
+	records, err = l.query(150, "")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(records) != 1 || records[0].AppId != "gimp" {
+		t.Fatalf("since=150 filter returned %#v", records)
+	}
+
+	records, err = l.query(0, "firefox")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(records) != 1 || records[0].AppId != "firefox" {
+		t.Fatalf("appId filter returned %#v", records)
+	}
+}
+
+func TestAuditLoggerRotation(t *testing.T) {
+	l := &auditLogger{path: filepath.Join(t.TempDir(), "dock-audit.log")}
+
+	// Pre-fill the log past the rotation threshold with short lines so the
+	// query scan below doesn't choke on one giant token.
+	line := "{\"timestamp\":0,\"action\":\"filler\"}\n"
+	var filler []byte
+	for len(filler) < auditLogMaxSize+1 {
+		filler = append(filler, line...)
+	}
+	if err := os.WriteFile(l.path, filler, 0644); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	l.record(AuditRecord{Timestamp: 1, Action: "dockEntry"})
+
+	rotated := l.path + ".1"
+	if _, err := os.Stat(rotated); err != nil {
+		t.Fatalf("expected rotated file %q to exist: %v", rotated, err)
+	}
+	info, err := os.Stat(l.path)
+	if err != nil {
+		t.Fatalf("expected fresh log file to exist: %v", err)
+	}
+	if info.Size() >= auditLogMaxSize {
+		t.Fatalf("fresh log file should be small, got %d bytes", info.Size())
+	}
+
+	records, err := l.query(1, "")
+	if err != nil {
+		t.Fatalf("query after rotation failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records after rotation, want 1", len(records))
+	}
+}
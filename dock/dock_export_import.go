@@ -0,0 +1,325 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	dutils "github.com/linuxdeepin/go-lib/utils"
+)
+
+// dockedAppKind distinguishes an entry whose .desktop file is a scratch file
+// carried inside the archive from one that points at a system-installed
+// .desktop file which is merely referenced by path.
+type dockedAppKind string
+
+const (
+	dockedAppKindScratch   dockedAppKind = "scratch"
+	dockedAppKindInstalled dockedAppKind = "installed"
+)
+
+// dockedAppManifestEntry is one manifest.json entry written into an
+// exported archive, describing one docked app.
+type dockedAppManifestEntry struct {
+	Kind       dockedAppKind `json:"kind"`
+	OriginPath string        `json:"originPath"`
+	InnerId    string        `json:"innerId"`
+	Sha256     string        `json:"sha256"`
+}
+
+type dockedAppManifest struct {
+	Version int                      `json:"version"`
+	Entries []dockedAppManifestEntry `json:"entries"`
+}
+
+const dockedAppManifestVersion = 1
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func tarAddFile(tw *tar.Writer, path, archiveName string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = archiveName
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// ExportDockedApps writes every currently docked app into a single tar.gz
+// archive at path: scratch entries carry their .desktop and wrapper .sh
+// files, plus a <name>.png beside them under scratchDir where one exists,
+// while entries backed by an installed .desktop file are recorded by path
+// only, since that file is expected to exist on the target machine too.
+// Icons held under iconCacheDir are not written into the archive.
+func (m *Manager) ExportDockedApps(path string) *dbus.Error {
+	if err := m.exportDockedApps(path); err != nil {
+		return dbusutil.ToError(err)
+	}
+	return nil
+}
+
+func (m *Manager) exportDockedApps(path string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gw := gzip.NewWriter(out)
+	defer gw.Close()
+	tw := tar.NewWriter(gw)
+	defer tw.Close()
+
+	manifest := dockedAppManifest{Version: dockedAppManifestVersion}
+
+	for _, entry := range m.Entries.FilterDocked() {
+		if entry.appInfo == nil {
+			continue
+		}
+		desktopFile := entry.appInfo.GetFileName()
+
+		if !isFileInDir(desktopFile, scratchDir) {
+			// Installed app: nothing to carry in the archive, just record
+			// where it lives so import can re-dock it if that same path
+			// exists on the target machine; it is not matched against other
+			// installed apps.
+			sum, err := sha256File(desktopFile)
+			if err != nil {
+				logger.Warning("exportDockedApps: sha256 failed for", desktopFile, err)
+				continue
+			}
+			manifest.Entries = append(manifest.Entries, dockedAppManifestEntry{
+				Kind:       dockedAppKindInstalled,
+				OriginPath: desktopFile,
+				InnerId:    entry.appInfo.innerId,
+				Sha256:     sum,
+			})
+			continue
+		}
+
+		fileNoExt := trimDesktopExt(desktopFile)
+		for _, ext := range []string{".desktop", ".sh", ".png"} {
+			file := fileNoExt + ext
+			if _, err := os.Stat(file); err != nil {
+				continue
+			}
+			sum, err := sha256File(file)
+			if err != nil {
+				return err
+			}
+			archiveName := filepath.Join("scratch", filepath.Base(file))
+			if err := tarAddFile(tw, file, archiveName); err != nil {
+				return err
+			}
+			manifest.Entries = append(manifest.Entries, dockedAppManifestEntry{
+				Kind:       dockedAppKindScratch,
+				OriginPath: file,
+				InnerId:    entry.appInfo.innerId,
+				Sha256:     sum,
+			})
+		}
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestHdr := &tar.Header{
+		Name: "manifest.json",
+		Mode: 0644,
+		Size: int64(len(manifestBytes)),
+	}
+	if err := tw.WriteHeader(manifestHdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifestBytes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ImportDockedApps reads an archive produced by ExportDockedApps, re-creates
+// its scratch files under scratchDir, and docks every app it describes
+// regardless of whether it happens to be running on this machine already.
+// Entries pointing at an installed .desktop file are only docked if that
+// path still exists here. If merge is false, the current docked list is
+// replaced with the imported one; otherwise it's added to.
+func (m *Manager) ImportDockedApps(path string, merge bool) *dbus.Error {
+	if err := m.importDockedApps(path, merge); err != nil {
+		return dbusutil.ToError(err)
+	}
+	return nil
+}
+
+func (m *Manager) importDockedApps(path string, merge bool) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	gr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+
+	// #nosec G301
+	if err := os.MkdirAll(scratchDir, 0755); err != nil {
+		return err
+	}
+
+	var previouslyDocked AppEntries
+	if !merge {
+		previouslyDocked = append(AppEntries(nil), m.Entries.FilterDocked()...)
+	}
+
+	var manifest dockedAppManifest
+	restored := make(map[string]string) // innerId -> restored desktop path
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if hdr.Name == "manifest.json" {
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return fmt.Errorf("parse manifest.json: %w", err)
+			}
+			continue
+		}
+
+		if filepath.Dir(hdr.Name) != "scratch" {
+			continue
+		}
+		destFile := filepath.Join(scratchDir, filepath.Base(hdr.Name))
+		// #nosec G306
+		destMode := os.FileMode(0644)
+		if filepath.Ext(destFile) == ".sh" {
+			destMode = 0744
+		}
+		out, err := os.OpenFile(destFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, destMode)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+		if filepath.Ext(destFile) == ".desktop" {
+			restored[trimDesktopExt(destFile)] = destFile
+		}
+	}
+
+	importedInnerIds := make(map[string]bool, len(manifest.Entries))
+	for _, e := range manifest.Entries {
+		if e.Kind == dockedAppKindScratch && filepath.Ext(e.OriginPath) != ".desktop" {
+			// The .sh wrapper and .png icon manifest entries only exist so
+			// exportDockedApps' sha256 covers every scratch file it wrote;
+			// they were already restored to scratchDir above and aren't
+			// themselves dockable, so skip them here rather than letting
+			// resolveImportedDesktopFile reject them as an "error".
+			continue
+		}
+		desktopFile, err := resolveImportedDesktopFile(e, restored)
+		if err != nil {
+			logger.Warning("importDockedApps: skipping entry:", err)
+			continue
+		}
+		importedInnerIds[e.InnerId] = true
+
+		// Re-dock directly instead of only patching an already-running
+		// AppEntry: right after moving to a new machine the docked app is
+		// normally not running yet, which is the whole point of this
+		// feature.
+		ok, err := m.RequestDock(desktopFile, -1)
+		if err != nil || !ok {
+			logger.Warning("importDockedApps: failed to dock", desktopFile, err)
+		}
+	}
+
+	if !merge {
+		// Replace: anything that was docked before the import and isn't
+		// part of the imported manifest gets undocked.
+		for _, entry := range previouslyDocked {
+			if !importedInnerIds[entry.innerId] {
+				m.undockEntry(entry)
+			}
+		}
+		m.saveDockedApps()
+	}
+	return nil
+}
+
+// resolveImportedDesktopFile finds the on-disk .desktop file a manifest
+// entry should be docked from: the freshly-restored scratch file for a
+// "scratch" entry, or the original install path for an "installed" entry
+// (only if it still exists on this machine).
+func resolveImportedDesktopFile(e dockedAppManifestEntry, restored map[string]string) (string, error) {
+	switch e.Kind {
+	case dockedAppKindInstalled:
+		if !dutils.IsFileExist(e.OriginPath) {
+			return "", fmt.Errorf("%s is not installed on this machine", e.OriginPath)
+		}
+		return e.OriginPath, nil
+	case dockedAppKindScratch:
+		if filepath.Ext(e.OriginPath) != ".desktop" {
+			return "", fmt.Errorf("manifest entry %q is not a .desktop file", e.OriginPath)
+		}
+		desktopFile, ok := restored[trimDesktopExt(filepath.Join(scratchDir, filepath.Base(e.OriginPath)))]
+		if !ok {
+			return "", fmt.Errorf("%s was not found in the archive", e.OriginPath)
+		}
+		return desktopFile, nil
+	default:
+		return "", fmt.Errorf("unknown manifest entry kind %q", e.Kind)
+	}
+}
@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSha256File(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.desktop")
+	if err := os.WriteFile(file, []byte("[Desktop Entry]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := sha256File(file)
+	if err != nil {
+		t.Fatalf("sha256File failed: %v", err)
+	}
+
+	sum2, err := sha256File(file)
+	if err != nil {
+		t.Fatalf("sha256File failed: %v", err)
+	}
+	if sum != sum2 {
+		t.Fatalf("sha256File not stable across calls: %q != %q", sum, sum2)
+	}
+	if len(sum) != 64 {
+		t.Fatalf("expected a 64-char hex digest, got %q", sum)
+	}
+}
+
+func TestTarAddFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "app.sh")
+	content := []byte("#!/bin/sh\nexec app\n")
+	if err := os.WriteFile(src, content, 0744); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := filepath.Join(dir, "out.tar.gz")
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gzip.NewWriter(out)
+	tw := tar.NewWriter(gw)
+	if err := tarAddFile(tw, src, "scratch/app.sh"); err != nil {
+		t.Fatalf("tarAddFile failed: %v", err)
+	}
+	tw.Close()
+	gw.Close()
+	out.Close()
+
+	in, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	gr, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatalf("tar.Next failed: %v", err)
+	}
+	if hdr.Name != "scratch/app.sh" {
+		t.Errorf("archive name = %q, want %q", hdr.Name, "scratch/app.sh")
+	}
+	got, err := io.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("round-tripped content = %q, want %q", got, content)
+	}
+}
+
+func TestResolveImportedDesktopFile(t *testing.T) {
+	// resolveImportedDesktopFile looks scratch entries up under scratchDir,
+	// where importDockedApps restores them.
+	dir := withScratchDir(t)
+	installedPath := filepath.Join(dir, "installed.desktop")
+	if err := os.WriteFile(installedPath, []byte("[Desktop Entry]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := map[string]string{
+		filepath.Join(dir, "scratch-app"): filepath.Join(dir, "scratch-app.desktop"),
+	}
+
+	cases := []struct {
+		name    string
+		entry   dockedAppManifestEntry
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "installed app present on this machine",
+			entry: dockedAppManifestEntry{Kind: dockedAppKindInstalled, OriginPath: installedPath},
+			want:  installedPath,
+		},
+		{
+			name:    "installed app missing on this machine",
+			entry:   dockedAppManifestEntry{Kind: dockedAppKindInstalled, OriginPath: filepath.Join(dir, "missing.desktop")},
+			wantErr: true,
+		},
+		{
+			name:  "scratch app restored from archive",
+			entry: dockedAppManifestEntry{Kind: dockedAppKindScratch, OriginPath: filepath.Join(dir, "scratch-app.desktop")},
+			want:  filepath.Join(dir, "scratch-app.desktop"),
+		},
+		{
+			name:    "scratch app not found in archive",
+			entry:   dockedAppManifestEntry{Kind: dockedAppKindScratch, OriginPath: filepath.Join(dir, "other.desktop")},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := resolveImportedDesktopFile(c.entry, restored)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got path %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestDockedAppManifestJSONRoundTrip(t *testing.T) {
+	manifest := dockedAppManifest{
+		Version: dockedAppManifestVersion,
+		Entries: []dockedAppManifestEntry{
+			{Kind: dockedAppKindScratch, OriginPath: "/a.desktop", InnerId: "a", Sha256: "deadbeef"},
+			{Kind: dockedAppKindInstalled, OriginPath: "/usr/share/applications/b.desktop", InnerId: "b"},
+		},
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var got dockedAppManifest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if len(got.Entries) != 2 || got.Entries[0].Kind != dockedAppKindScratch || got.Entries[1].Kind != dockedAppKindInstalled {
+		t.Fatalf("round-tripped manifest mismatch: %#v", got)
+	}
+}
@@ -0,0 +1,249 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	dutils "github.com/linuxdeepin/go-lib/utils"
+)
+
+// iconCacheDir holds icons resolved by the data: URI and http(s)
+// resolvers, keyed by content hash so repeated dock/undock
+// cycles don't churn files.
+func iconCacheDir() string {
+	return filepath.Join(scratchDir, "icon-cache")
+}
+
+// IconResolver turns an icon reference (a data: URI, a file:// URL, an
+// http(s):// URL, or a bare freedesktop icon name) into a path to a file on
+// disk that a .desktop Icon= line can reference. Resolvers that don't
+// recognize icon should return ("", false, nil) so the next one in line can
+// try.
+type IconResolver interface {
+	// Resolve returns the on-disk path for icon, whether it handled icon at
+	// all, and an error if it recognized icon but failed to resolve it.
+	Resolve(icon string) (path string, handled bool, err error)
+}
+
+var iconResolvers []IconResolver
+
+func init() {
+	registerIconResolver(dataUriIconResolver{})
+	registerIconResolver(fileUriIconResolver{})
+	registerIconResolver(httpIconResolver{client: &http.Client{Timeout: 10 * time.Second}})
+	registerIconResolver(themeIconResolver{})
+}
+
+func registerIconResolver(resolver IconResolver) {
+	iconResolvers = append([]IconResolver{resolver}, iconResolvers...)
+}
+
+// RegisterIconResolver adds resolver to the front of the resolution chain,
+// so out-of-tree plugins compiled in via build tags can take precedence over
+// the built-in resolvers. It's a Manager method, rather than a package
+// function, so plugins register against a running daemon instance the same
+// way every other dock extension point works.
+func (m *Manager) RegisterIconResolver(resolver IconResolver) {
+	registerIconResolver(resolver)
+}
+
+// resolveIcon runs icon through the registered resolver chain, falling back
+// to "application-default-icon" if nothing claims it.
+func resolveIcon(icon string) string {
+	if icon == "" {
+		return "application-default-icon"
+	}
+	for _, resolver := range iconResolvers {
+		path, handled, err := resolver.Resolve(icon)
+		if !handled {
+			continue
+		}
+		if err != nil {
+			logger.Warning("icon resolver failed:", err)
+			return "application-default-icon"
+		}
+		return path
+	}
+	// not a URI, cache-backed form or bare theme name we understand
+	return "application-default-icon"
+}
+
+func contentHashFilename(content []byte, ext string) (string, error) {
+	h := sha256.Sum256(content)
+	return hex.EncodeToString(h[:]) + ext, nil
+}
+
+func writeIconCacheFile(content []byte, ext string) (string, error) {
+	dir := iconCacheDir()
+	// #nosec G301
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name, err := contentHashFilename(content, ext)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if dutils.IsFileExist(path) {
+		return path, nil
+	}
+	// #nosec G306
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+type dataUriIconResolver struct{}
+
+func (dataUriIconResolver) Resolve(icon string) (string, bool, error) {
+	if !strings.HasPrefix(icon, "data:image") {
+		return "", false, nil
+	}
+	content, err := decodeDataUriContent(icon)
+	if err != nil {
+		return "", true, err
+	}
+	cached, err := writeIconCacheFile(content, ".png")
+	if err != nil {
+		return "", true, err
+	}
+	return cached, true, nil
+}
+
+// decodeDataUriContent extracts the raw bytes encoded in a
+// "data:<mime>;base64,<payload>" URI.
+func decodeDataUriContent(uri string) ([]byte, error) {
+	idx := strings.Index(uri, ",")
+	if idx < 0 || !strings.Contains(uri[:idx], "base64") {
+		return nil, errors.New("unsupported data URI encoding")
+	}
+	return base64.StdEncoding.DecodeString(uri[idx+1:])
+}
+
+type fileUriIconResolver struct{}
+
+func (fileUriIconResolver) Resolve(icon string) (string, bool, error) {
+	if !strings.HasPrefix(icon, "file://") {
+		return "", false, nil
+	}
+	path := strings.TrimPrefix(icon, "file://")
+	if !dutils.IsFileExist(path) {
+		return "", true, errors.New("file icon not found: " + path)
+	}
+	return path, true, nil
+}
+
+type httpIconResolver struct {
+	client *http.Client
+}
+
+func (r httpIconResolver) Resolve(icon string) (string, bool, error) {
+	if !strings.HasPrefix(icon, "http://") && !strings.HasPrefix(icon, "https://") {
+		return "", false, nil
+	}
+	resp, err := r.client.Get(icon)
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", true, errors.New("fetch icon " + icon + " failed: " + resp.Status)
+	}
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", true, err
+	}
+	ext := filepath.Ext(icon)
+	if ext == "" || len(ext) > 5 {
+		ext = ".png"
+	}
+	cached, err := writeIconCacheFile(content, ext)
+	if err != nil {
+		return "", true, err
+	}
+	return cached, true, nil
+}
+
+// themeIconResolver handles plain freedesktop icon-theme names by leaving
+// them untouched for the desktop environment's icon lookup to resolve at
+// display time. It never fails and only claims strings with no '/' or ':',
+// so although it is registered last (and therefore sits at the front of the
+// chain) it never shadows the URI resolvers.
+type themeIconResolver struct{}
+
+func (themeIconResolver) Resolve(icon string) (string, bool, error) {
+	if strings.ContainsAny(icon, "/:") {
+		return "", false, nil
+	}
+	return icon, true, nil
+}
+
+// scheduleIconCacheJanitor prunes iconCacheDir of any cached icon no longer
+// referenced by a currently docked entry. It runs on every dock/undock:
+// pruning is cheap (a directory listing plus reading each docked entry's
+// .desktop file), and running it just once per daemon lifetime would leave
+// icons dropped by later undocks never collected.
+func (m *Manager) scheduleIconCacheJanitor() {
+	m.pruneIconCache()
+}
+
+// pruneIconCache removes cached icons under iconCacheDir that no currently
+// docked entry references.
+func (m *Manager) pruneIconCache() {
+	var desktopFiles []string
+	for _, entry := range m.Entries.FilterDocked() {
+		if entry.appInfo == nil {
+			continue
+		}
+		desktopFiles = append(desktopFiles, entry.appInfo.GetFileName())
+	}
+	pruneIconCacheFiles(iconCacheDir(), desktopFiles)
+}
+
+// pruneIconCacheFiles removes every file directly under dir whose name isn't
+// referenced (as a plain substring match, the same way dock's own Icon=
+// line embeds a cache filename) by the content of any file in
+// desktopFiles. It's split out from pruneIconCache so the substring-match
+// logic can be exercised without a live Manager/AppEntry.
+func pruneIconCacheFiles(dir string, desktopFiles []string) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	inUse := make(map[string]bool)
+	for _, path := range desktopFiles {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			if strings.Contains(string(content), f.Name()) {
+				inUse[f.Name()] = true
+			}
+		}
+	}
+
+	for _, f := range files {
+		if inUse[f.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f.Name())); err != nil {
+			logger.Warningf("pruneIconCache: failed to remove %q: %v", f.Name(), err)
+		}
+	}
+}
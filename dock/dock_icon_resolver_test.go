@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withScratchDir points scratchDir (and therefore iconCacheDir) at a fresh
+// temp directory for the duration of the test.
+func withScratchDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	old := scratchDir
+	scratchDir = dir
+	t.Cleanup(func() { scratchDir = old })
+	return dir
+}
+
+func TestContentHashFilenameStable(t *testing.T) {
+	name1, err := contentHashFilename([]byte("icon bytes"), ".png")
+	if err != nil {
+		t.Fatalf("contentHashFilename failed: %v", err)
+	}
+	name2, err := contentHashFilename([]byte("icon bytes"), ".png")
+	if err != nil {
+		t.Fatalf("contentHashFilename failed: %v", err)
+	}
+	if name1 != name2 {
+		t.Fatalf("contentHashFilename not stable for identical content: %q != %q", name1, name2)
+	}
+
+	name3, _ := contentHashFilename([]byte("other bytes"), ".png")
+	if name3 == name1 {
+		t.Errorf("contentHashFilename collided for different content: %q", name1)
+	}
+
+	if filepath.Ext(name1) != ".png" {
+		t.Errorf("contentHashFilename dropped the extension: %q", name1)
+	}
+}
+
+func TestWriteIconCacheFileIsContentAddressedAndStable(t *testing.T) {
+	withScratchDir(t)
+
+	path1, err := writeIconCacheFile([]byte("same icon"), ".png")
+	if err != nil {
+		t.Fatalf("writeIconCacheFile failed: %v", err)
+	}
+	path2, err := writeIconCacheFile([]byte("same icon"), ".png")
+	if err != nil {
+		t.Fatalf("writeIconCacheFile failed: %v", err)
+	}
+	if path1 != path2 {
+		t.Fatalf("writeIconCacheFile returned different paths for identical content across dock/undock-style calls: %q != %q", path1, path2)
+	}
+
+	content, err := os.ReadFile(path1)
+	if err != nil {
+		t.Fatalf("expected cache file to exist: %v", err)
+	}
+	if string(content) != "same icon" {
+		t.Errorf("cache file content = %q, want %q", content, "same icon")
+	}
+}
+
+func TestDataUriIconResolverRoundTrip(t *testing.T) {
+	withScratchDir(t)
+
+	// base64 of "fake png bytes"
+	uri := "data:image/png;base64,ZmFrZSBwbmcgYnl0ZXM="
+	path, handled, err := (dataUriIconResolver{}).Resolve(uri)
+	if !handled {
+		t.Fatalf("dataUriIconResolver did not claim a data: URI")
+	}
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected decoded icon file to exist: %v", err)
+	}
+	if string(content) != "fake png bytes" {
+		t.Errorf("decoded content = %q, want %q", content, "fake png bytes")
+	}
+
+	// Resolving the same data URI again (as happens across repeated
+	// dock/undock cycles) must reuse the same cache filename.
+	path2, _, err := (dataUriIconResolver{}).Resolve(uri)
+	if err != nil {
+		t.Fatalf("Resolve failed on second call: %v", err)
+	}
+	if path != path2 {
+		t.Errorf("dataUriIconResolver cache filename not stable: %q != %q", path, path2)
+	}
+}
+
+func TestDataUriIconResolverRejectsNonImage(t *testing.T) {
+	_, handled, _ := (dataUriIconResolver{}).Resolve("file:///icon.png")
+	if handled {
+		t.Errorf("dataUriIconResolver should not claim a non-data URI")
+	}
+}
+
+func TestFileUriIconResolver(t *testing.T) {
+	dir := t.TempDir()
+	iconFile := filepath.Join(dir, "icon.png")
+	if err := os.WriteFile(iconFile, []byte("icon"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path, handled, err := (fileUriIconResolver{}).Resolve("file://" + iconFile)
+	if !handled {
+		t.Fatalf("fileUriIconResolver did not claim a file:// URI")
+	}
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if path != iconFile {
+		t.Errorf("Resolve path = %q, want %q", path, iconFile)
+	}
+
+	_, handled, err = (fileUriIconResolver{}).Resolve("file://" + filepath.Join(dir, "missing.png"))
+	if !handled {
+		t.Fatalf("fileUriIconResolver should claim (and fail on) a missing file:// URI")
+	}
+	if err == nil {
+		t.Errorf("expected an error for a missing icon file")
+	}
+}
+
+func TestThemeIconResolverPassthrough(t *testing.T) {
+	name, handled, err := (themeIconResolver{}).Resolve("application-default-icon")
+	if !handled || err != nil {
+		t.Fatalf("themeIconResolver should handle a bare icon name, got handled=%v err=%v", handled, err)
+	}
+	if name != "application-default-icon" {
+		t.Errorf("themeIconResolver rewrote a bare icon name to %q", name)
+	}
+
+	if _, handled, _ := (themeIconResolver{}).Resolve("/some/path.png"); handled {
+		t.Errorf("themeIconResolver should not claim a path-like icon")
+	}
+}
+
+func TestResolveIconFallsBackToDefault(t *testing.T) {
+	// Nothing in the resolver chain claims a string that looks like neither
+	// a URI nor a bare theme name.
+	if got := resolveIcon("weird:/mixed"); got != "application-default-icon" {
+		t.Errorf("resolveIcon(weird:/mixed) = %q, want application-default-icon", got)
+	}
+	if got := resolveIcon(""); got != "application-default-icon" {
+		t.Errorf("resolveIcon(\"\") = %q, want application-default-icon", got)
+	}
+}
+
+func TestPruneIconCacheFilesRemovesOnlyUnreferenced(t *testing.T) {
+	dir := t.TempDir()
+	usedCache := filepath.Join(dir, "used.png")
+	unusedCache := filepath.Join(dir, "unused.png")
+	for _, f := range []string{usedCache, unusedCache} {
+		if err := os.WriteFile(f, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	desktopDir := t.TempDir()
+	desktopFile := filepath.Join(desktopDir, "firefox.desktop")
+	content := "[Desktop Entry]\nIcon=" + usedCache + "\n"
+	if err := os.WriteFile(desktopFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pruneIconCacheFiles(dir, []string{desktopFile})
+
+	if _, err := os.Stat(usedCache); err != nil {
+		t.Errorf("pruneIconCacheFiles removed a cache file still referenced by a docked entry: %v", err)
+	}
+	if _, err := os.Stat(unusedCache); !os.IsNotExist(err) {
+		t.Errorf("pruneIconCacheFiles left an unreferenced cache file in place")
+	}
+}
+
+func TestPruneIconCacheFilesNoDockedEntries(t *testing.T) {
+	dir := t.TempDir()
+	cache := filepath.Join(dir, "orphan.png")
+	if err := os.WriteFile(cache, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pruneIconCacheFiles(dir, nil)
+
+	if _, err := os.Stat(cache); !os.IsNotExist(err) {
+		t.Errorf("pruneIconCacheFiles should remove cache files when nothing references them")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/godbus/dbus"
 	dutils "github.com/linuxdeepin/go-lib/utils"
 )
 
@@ -28,14 +29,17 @@ type dockedItemInfo struct {
 	Name, Icon, Exec string
 }
 
-func createScratchDesktopFile(id, title, icon, cmd string) (string, error) {
+func createScratchDesktopFile(id, title, icon, cmd string) (filename string, err error) {
 	logger.Debugf("create scratch file for %q", id)
-	filename := filepath.Join(scratchDir, addDesktopExt(id))
+	defer func() {
+		logAuditRecord("createScratchDesktopFile", id, filename, err)
+	}()
+	filename = filepath.Join(scratchDir, addDesktopExt(id))
 	dockedItem := dockedItemInfo{title, icon, cmd}
 	logger.Debugf("dockedItem: %#v", dockedItem)
 	content := fmt.Sprintf(dockedItemTemplate, dockedItem.Name, dockedItem.Exec, dockedItem.Icon)
 	// #nosec G306
-	err := ioutil.WriteFile(filename, []byte(content), 0644)
+	err = ioutil.WriteFile(filename, []byte(content), 0644)
 	if err != nil {
 		return "", err
 	}
@@ -45,6 +49,15 @@ func createScratchDesktopFile(id, title, icon, cmd string) (string, error) {
 func removeScratchFiles(desktopFile string) {
 	fileNoExt := trimDesktopExt(desktopFile)
 	logger.Debug("removeScratchFiles", fileNoExt)
+	// Hash the desktop file before deleting it below; sha256OfFile can't
+	// read a file that's already gone.
+	sum := sha256OfFile(desktopFile)
+	var lastErr error
+	// .sh covers both the plain launch wrapper and the bwrap sandbox
+	// wrapper convertToScratchSandboxEntry writes; sandbox profiles
+	// themselves are never cached per entry (loadSandboxProfile reads them
+	// live from sandboxProfileDir() by name on every regenerate), so there
+	// is nothing sandbox-specific left to clean up here.
 	extList := []string{".desktop", ".sh", ".png"}
 	for _, ext := range extList {
 		file := fileNoExt + ext
@@ -53,12 +66,17 @@ func removeScratchFiles(desktopFile string) {
 			err := os.Remove(file)
 			if err != nil {
 				logger.Warningf("failed to remove scratch file %q: %v", file, err)
+				lastErr = err
 			}
 		}
 	}
+	// icon-cache entries are content-addressed and may be shared by other
+	// docked entries, so they are never removed here; undockEntry calls
+	// Manager.scheduleIconCacheJanitor to garbage-collect unreferenced ones.
+	logAuditRecordWithHash("removeScratchFiles", "", desktopFile, sum, lastErr)
 }
 
-func createScratchDesktopFileWithAppEntry(entry *AppEntry) (string, error) {
+func createScratchDesktopFileWithAppEntry(sessionBus *dbus.Conn, entry *AppEntry) (string, error) {
 	// #nosec G301
 	err := os.MkdirAll(scratchDir, 0755)
 	if err != nil {
@@ -81,22 +99,18 @@ func createScratchDesktopFileWithAppEntry(entry *AppEntry) (string, error) {
 	appId := entry.current.getInnerId()
 	title := entry.current.getDisplayName()
 	// icon
-	icon := entry.current.getIcon()
-	if strings.HasPrefix(icon, "data:image") {
-		path, err := dataUriToFile(icon, filepath.Join(scratchDir, appId+".png"))
+	icon := resolveIcon(entry.current.getIcon())
+
+	// cmd
+	scriptContent := entry.getExec(false)
+	if entry.IsSandboxed && entry.SandboxProfile != "" {
+		profile, err := loadSandboxProfile(entry.SandboxProfile)
 		if err != nil {
-			logger.Warning(err)
-			icon = ""
+			logger.Warning("failed to load sandbox profile, launching unconfined:", err)
 		} else {
-			icon = path
+			scriptContent = buildSandboxWrapperScript(sessionBus, profile, scriptContent, title)
 		}
 	}
-	if icon == "" {
-		icon = "application-default-icon"
-	}
-
-	// cmd
-	scriptContent := entry.getExec(false)
 	scriptFile := filepath.Join(scratchDir, appId+".sh")
 	// #nosec G306
 	err = ioutil.WriteFile(scriptFile, []byte(scriptContent), 0744)
@@ -143,7 +157,20 @@ func needScratchDesktop(appInfo *AppInfo) bool {
 	return true
 }
 
-func (m *Manager) dockEntry(entry *AppEntry) (bool, error) {
+// entryDesktopPath returns entry's current .desktop file path, or "" if it
+// doesn't have one yet (appInfo not set).
+func entryDesktopPath(entry *AppEntry) string {
+	if entry.appInfo == nil {
+		return ""
+	}
+	return entry.appInfo.GetFileName()
+}
+
+func (m *Manager) dockEntry(entry *AppEntry) (ok bool, err error) {
+	defer func() {
+		logAuditRecord("dockEntry", entry.Id, entryDesktopPath(entry), err)
+	}()
+
 	entry.PropsMu.Lock()
 
 	if entry.IsDocked {
@@ -152,7 +179,7 @@ func (m *Manager) dockEntry(entry *AppEntry) (bool, error) {
 		return false, nil
 	}
 	if needScratchDesktop(entry.appInfo) {
-		file, err := createScratchDesktopFileWithAppEntry(entry)
+		file, err := createScratchDesktopFileWithAppEntry(m.sessionBus, entry)
 		if err != nil {
 			logger.Warning("createScratchDesktopFileWithAppEntry failed", err)
 			entry.PropsMu.Unlock()
@@ -168,6 +195,9 @@ func (m *Manager) dockEntry(entry *AppEntry) (bool, error) {
 	entry.setPropIsDocked(true)
 	entry.updateMenu()
 	entry.PropsMu.Unlock()
+
+	m.applyDockedAppPowerPolicy(entry)
+	m.scheduleIconCacheJanitor()
 	return true, nil
 }
 
@@ -177,6 +207,16 @@ func isFileInDir(file, dir string) bool {
 }
 
 func (m *Manager) undockEntry(entry *AppEntry) {
+	// Capture entry's desktop path and hash before removeScratchFiles
+	// (below) can delete the file, or entry.appInfo is mutated further down
+	// (the windowHashPrefix/re-identify branches), so the deferred audit
+	// record logs what was actually undocked rather than a live re-read of
+	// entry.appInfo after it may have changed or been cleared.
+	var desktop, sum string
+	defer func() {
+		logAuditRecordWithHash("undockEntry", entry.Id, desktop, sum, nil)
+	}()
+
 	entry.PropsMu.RLock()
 	if !entry.IsDocked {
 		logger.Warningf("undockEntry failed: entry %v is not docked", entry.Id)
@@ -189,7 +229,8 @@ func (m *Manager) undockEntry(entry *AppEntry) {
 		entry.PropsMu.RUnlock()
 		return
 	}
-	desktop := entry.appInfo.GetFileName()
+	desktop = entry.appInfo.GetFileName()
+	sum = sha256OfFile(desktop)
 	logger.Debugf("undockEntry desktop: %q", desktop)
 	isDesktopInScratchDir := false
 	if isFileInDir(desktop, scratchDir) {
@@ -200,6 +241,9 @@ func (m *Manager) undockEntry(entry *AppEntry) {
 	hasWin := entry.hasWindow()
 	entry.PropsMu.RUnlock()
 
+	m.applyDockedAppPowerPolicy(entry)
+	m.scheduleIconCacheJanitor()
+
 	if !hasWin {
 		m.removeAppEntry(entry)
 	} else {
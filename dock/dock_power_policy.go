@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus"
+	"github.com/linuxdeepin/dde-daemon/session/power"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+)
+
+// PowerPolicy describes how the power/screensaver state should be adjusted
+// while a docked app has a focused or running window.
+//
+// ForcePerformanceGovernor and AllowDisplaySleepWhenFullscreen were part of
+// the original proposal but are not implemented yet (they need governor
+// control and fullscreen-window tracking this package doesn't have) and were
+// dropped rather than shipped as knobs that silently do nothing.
+type PowerPolicy struct {
+	// InhibitScreenSaverWhenFocused inhibits the screensaver while the entry
+	// has any window; whether that window is focused is not checked.
+	InhibitScreenSaverWhenFocused bool
+	PreventSuspendWhileRunning    bool
+}
+
+// powerInhibitor tracks the fds/cookies held on behalf of one docked entry
+// so they can be released when the entry's windows go away.
+type powerInhibitor struct {
+	screenSaverCookie uint32
+	loginInhibitFd    dbus.UnixFD
+	haveScreenSaver   bool
+	haveLoginInhibit  bool
+}
+
+// dockPowerBridge holds the power-related D-Bus objects the dock manager
+// needs to enforce per-app PowerPolicy, and the currently active
+// inhibitors keyed by desktop entry id. Its proxies come from a
+// session/power.Helper that newDockPowerBridge builds on the manager's
+// session and system bus connections, with signal loops of its own;
+// helper.SessionManager and helper.Power are held as part of that Helper
+// even though only ScreenSaver.Inhibit and LoginManager.Inhibit are called
+// (see PowerPolicy's doc comment for the knobs that would need them).
+type dockPowerBridge struct {
+	helper *power.Helper
+
+	// mu guards policies and inhibitors: SetDockedAppPowerPolicy (a D-Bus
+	// call) writes policies while applyDockedAppPowerPolicy (invoked from
+	// dockEntry/undockEntry and the window-appeared/disappeared handlers,
+	// each on its own goroutine per docked app) reads policies and
+	// inserts into inhibitors.
+	//
+	// Both maps are keyed by entry.innerId rather than the entry's desktop
+	// file path: sandboxing (DockAppSandboxed/convertToScratchSandboxEntry)
+	// and re-identification on dock/undock repoint entry.appInfo at a new
+	// path, which would otherwise orphan a policy under its old path.
+	mu         sync.Mutex
+	policies   map[string]PowerPolicy // innerId -> policy
+	inhibitors map[string]*powerInhibitor
+}
+
+func newDockPowerBridge(sessionBus, systemBus *dbus.Conn) *dockPowerBridge {
+	bridge := &dockPowerBridge{
+		policies:   make(map[string]PowerPolicy),
+		inhibitors: make(map[string]*powerInhibitor),
+	}
+
+	helper, err := power.NewHelper(systemBus, sessionBus)
+	if err != nil {
+		logger.Warning("newDockPowerBridge: power.NewHelper failed, per-app power policies are disabled:", err)
+		return bridge
+	}
+	systemSigLoop := dbusutil.NewSignalLoop(systemBus, 10)
+	sessionSigLoop := dbusutil.NewSignalLoop(sessionBus, 10)
+	systemSigLoop.Start()
+	sessionSigLoop.Start()
+	helper.InitSignalExt(systemSigLoop, sessionSigLoop)
+
+	bridge.helper = helper
+	return bridge
+}
+
+// getPowerBridge lazily creates the power bridge (and loads any
+// previously-persisted policies) on first use, so dockEntry/undockEntry
+// calling applyDockedAppPowerPolicy before an explicit wiring step doesn't
+// dereference a nil Manager.powerBridge.
+func (m *Manager) getPowerBridge() *dockPowerBridge {
+	m.powerBridgeOnce.Do(func() {
+		bridge := newDockPowerBridge(m.sessionBus, m.systemBus)
+		if m.DockedAppPowerPolicies != nil {
+			bridge.mu.Lock()
+			for innerId, policy := range m.DockedAppPowerPolicies.Get() {
+				bridge.policies[innerId] = policy
+			}
+			bridge.mu.Unlock()
+		}
+		m.powerBridge = bridge
+	})
+	return m.powerBridge
+}
+
+// SetDockedAppPowerPolicy sets the power policy to apply while desktopID has
+// running or focused windows, and persists it alongside DockedApps.
+func (m *Manager) SetDockedAppPowerPolicy(desktopID string, policy PowerPolicy) *dbus.Error {
+	entry, err := m.getDockedAppEntryByDesktopFilePath(desktopID)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+
+	bridge := m.getPowerBridge()
+	bridge.mu.Lock()
+	bridge.policies[entry.innerId] = policy
+	bridge.mu.Unlock()
+	m.saveDockedAppPowerPolicies()
+
+	if entry.hasWindow() {
+		m.applyDockedAppPowerPolicy(entry)
+	}
+	return nil
+}
+
+// applyDockedAppPowerPolicy takes or releases inhibitors for entry depending
+// on whether it currently has windows and on the policy configured for it.
+func (m *Manager) applyDockedAppPowerPolicy(entry *AppEntry) {
+	if entry.appInfo == nil {
+		return
+	}
+	innerId := entry.innerId
+	bridge := m.getPowerBridge()
+	if bridge.helper == nil {
+		return
+	}
+	bridge.mu.Lock()
+	defer bridge.mu.Unlock()
+
+	policy, ok := bridge.policies[innerId]
+	if !ok {
+		return
+	}
+
+	hasWin := entry.hasWindow()
+	inh, exists := bridge.inhibitors[innerId]
+	if !exists {
+		inh = &powerInhibitor{}
+		bridge.inhibitors[innerId] = inh
+	}
+
+	if hasWin {
+		if policy.InhibitScreenSaverWhenFocused && !inh.haveScreenSaver {
+			cookie, err := bridge.helper.ScreenSaver.Inhibit(0, "dde-dock", "docked app focused")
+			if err != nil {
+				logger.Warning("SetDockedAppPowerPolicy: ScreenSaver.Inhibit failed:", err)
+			} else {
+				inh.screenSaverCookie = cookie
+				inh.haveScreenSaver = true
+			}
+		}
+		if policy.PreventSuspendWhileRunning && !inh.haveLoginInhibit {
+			fd, err := bridge.helper.LoginManager.Inhibit(0, "sleep", "dde-dock",
+				"docked app running", "block")
+			if err != nil {
+				logger.Warning("SetDockedAppPowerPolicy: LoginManager.Inhibit failed:", err)
+			} else {
+				inh.loginInhibitFd = fd
+				inh.haveLoginInhibit = true
+			}
+		}
+	} else {
+		m.releaseDockedAppInhibitors(innerId, inh)
+	}
+}
+
+func (m *Manager) releaseDockedAppInhibitors(innerId string, inh *powerInhibitor) {
+	bridge := m.getPowerBridge()
+	if bridge.helper == nil {
+		return
+	}
+	if inh.haveScreenSaver {
+		if err := bridge.helper.ScreenSaver.UnInhibit(0, inh.screenSaverCookie); err != nil {
+			logger.Warning("releaseDockedAppInhibitors: UnInhibit failed:", err)
+		}
+		inh.haveScreenSaver = false
+	}
+	if inh.haveLoginInhibit {
+		if err := inh.loginInhibitFd.Close(); err != nil {
+			logger.Warning("releaseDockedAppInhibitors: close inhibit fd failed:", err)
+		}
+		inh.haveLoginInhibit = false
+	}
+}
+
+// HandleEntryWindowAppeared re-evaluates entry's power-policy inhibitors
+// when one of its windows appears. The window-management code path should
+// call this (and HandleEntryWindowDisappeared) on every window
+// attach/detach for entry, not just dockEntry/undockEntry call it at
+// dock/undock time: otherwise a policy's inhibitors are only taken or
+// released once, at pin/unpin time, instead of tracking whether entry
+// actually has a running window in between.
+func (m *Manager) HandleEntryWindowAppeared(entry *AppEntry) {
+	m.applyDockedAppPowerPolicy(entry)
+}
+
+// HandleEntryWindowDisappeared is the window-closed counterpart of
+// HandleEntryWindowAppeared.
+func (m *Manager) HandleEntryWindowDisappeared(entry *AppEntry) {
+	m.applyDockedAppPowerPolicy(entry)
+}
+
+// saveDockedAppPowerPolicies persists the bridge's policies alongside
+// DockedApps so configured policies survive restarts; getPowerBridge loads
+// them back on the next start.
+func (m *Manager) saveDockedAppPowerPolicies() {
+	bridge := m.getPowerBridge()
+	bridge.mu.Lock()
+	policies := make(map[string]PowerPolicy, len(bridge.policies))
+	for innerId, policy := range bridge.policies {
+		policies[innerId] = policy
+	}
+	bridge.mu.Unlock()
+	m.DockedAppPowerPolicies.Set(policies)
+}
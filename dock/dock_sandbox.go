@@ -0,0 +1,308 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/godbus/dbus"
+	notifications "github.com/linuxdeepin/go-dbus-factory/org.freedesktop.notifications"
+	"github.com/linuxdeepin/go-lib/dbusutil"
+	dutils "github.com/linuxdeepin/go-lib/utils"
+	"github.com/linuxdeepin/go-lib/xdg/basedir"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultSandboxCmd is the sandbox helper invoked to confine a docked app.
+// It can be overridden per profile via SandboxProfile.Command.
+const defaultSandboxCmd = "bwrap"
+
+// sandboxProfileDir holds the user-editable sandbox profiles, one YAML/JSON
+// file per profile name.
+func sandboxProfileDir() string {
+	return filepath.Join(basedir.GetUserConfigDir(), "deepin/dde-daemon/dock/sandbox")
+}
+
+// SandboxProfile describes how a docked app should be confined when it is
+// launched through a bwrap-based wrapper script.
+type SandboxProfile struct {
+	Name           string   `json:"-" yaml:"-"`
+	Command        string   `json:"command" yaml:"command"`
+	ShareHome      bool     `json:"shareHome" yaml:"shareHome"`
+	AllowNetwork   bool     `json:"allowNetwork" yaml:"allowNetwork"`
+	XdgPortalOnly  bool     `json:"xdgPortalOnly" yaml:"xdgPortalOnly"`
+	WaylandOnly    bool     `json:"waylandOnly" yaml:"waylandOnly"`
+	ExtraBwrapArgs []string `json:"extraBwrapArgs" yaml:"extraBwrapArgs"`
+}
+
+func loadSandboxProfile(name string) (*SandboxProfile, error) {
+	dir := sandboxProfileDir()
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		file := filepath.Join(dir, name+ext)
+		if !dutils.IsFileExist(file) {
+			continue
+		}
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		profile := &SandboxProfile{Name: name, Command: defaultSandboxCmd}
+		if err := yaml.Unmarshal(content, profile); err != nil {
+			return nil, fmt.Errorf("parse sandbox profile %q: %w", name, err)
+		}
+		return profile, nil
+	}
+	return nil, fmt.Errorf("sandbox profile %q not found in %q", name, dir)
+}
+
+// buildBwrapArgs translates a SandboxProfile into the bwrap argument list
+// that wraps innerCmd.
+func (p *SandboxProfile) buildBwrapArgs(innerCmd string) []string {
+	args := []string{
+		"--ro-bind", "/usr", "/usr",
+		"--ro-bind", "/etc", "/etc",
+		"--symlink", "usr/lib", "/lib",
+		"--symlink", "usr/lib64", "/lib64",
+		"--symlink", "usr/bin", "/bin",
+		"--proc", "/proc",
+		"--dev", "/dev",
+		"--die-with-parent",
+	}
+	if p.ShareHome {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			args = append(args, "--bind", home, home)
+		}
+	} else {
+		args = append(args, "--tmpfs", "/home")
+	}
+	if !p.AllowNetwork {
+		args = append(args, "--unshare-net")
+	}
+
+	// A graphical app needs a way to reach the display server regardless of
+	// profile, or it will launch sandboxed and never show a window.
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir != "" {
+		if p.XdgPortalOnly {
+			doc := filepath.Join(runtimeDir, "doc")
+			args = append(args, "--bind", doc, doc)
+			if wl := os.Getenv("WAYLAND_DISPLAY"); wl != "" {
+				sock := wl
+				if !filepath.IsAbs(sock) {
+					sock = filepath.Join(runtimeDir, wl)
+				}
+				args = append(args, "--bind", sock, sock)
+			}
+		} else {
+			args = append(args, "--bind", runtimeDir, runtimeDir)
+		}
+	}
+	if p.WaylandOnly {
+		args = append(args, "--unsetenv", "DISPLAY")
+	} else if dutils.IsFileExist("/tmp/.X11-unix") {
+		args = append(args, "--bind", "/tmp/.X11-unix", "/tmp/.X11-unix")
+	}
+
+	args = append(args, p.ExtraBwrapArgs...)
+	args = append(args, "--", "sh", "-c", innerCmd)
+	return args
+}
+
+func bwrapAvailable() bool {
+	_, err := exec.LookPath(defaultSandboxCmd)
+	return err == nil
+}
+
+// notifySandboxFallback warns the user that a docked app launched without
+// the confinement it was configured for.
+func notifySandboxFallback(sessionBus *dbus.Conn, appName string) {
+	n := notifications.NewNotifications(sessionBus)
+	_, err := n.Notify(0, "dde-dock", 0, "dialog-warning", "Sandbox unavailable",
+		fmt.Sprintf("%s could not be sandboxed (%s is missing) and was launched unconfined.",
+			appName, defaultSandboxCmd), nil, nil, 0)
+	if err != nil {
+		logger.Warning("notifySandboxFallback failed:", err)
+	}
+}
+
+// shQuote POSIX-single-quotes s for safe embedding in a generated shell
+// script: unlike Go's %q, it leaves $, `, \ and other shell metacharacters
+// inert rather than relying on an escaping convention the outer, unsandboxed
+// shell doesn't honor.
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// buildSandboxWrapperScript produces the shell script content that dock
+// writes to scratchDir/<appId>.sh when entry is configured to run sandboxed.
+// Every bwrap argument, including innerCmd, is POSIX-single-quoted so that
+// the outer (unsandboxed) shell cannot expand `$(...)`, backticks or
+// variables embedded in a docked app's Exec= line or title before bwrap
+// starts. sessionBus is only used to notify the user if bwrap turns out to
+// be unavailable; callers pass their Manager.sessionBus.
+func buildSandboxWrapperScript(sessionBus *dbus.Conn, profile *SandboxProfile, innerCmd, appName string) string {
+	if !bwrapAvailable() {
+		notifySandboxFallback(sessionBus, appName)
+		return innerCmd
+	}
+	cmd := profile.Command
+	if cmd == "" {
+		cmd = defaultSandboxCmd
+	}
+	args := profile.buildBwrapArgs(innerCmd)
+	script := "#!/bin/sh\nexec " + shQuote(cmd)
+	for _, a := range args {
+		script += " " + shQuote(a)
+	}
+	script += "\n"
+	return script
+}
+
+// DockAppSandboxed sets (or clears, when profile is empty) the sandbox
+// profile used to launch the docked app identified by desktopID and
+// re-materializes its scratch wrapper script accordingly.
+func (m *Manager) DockAppSandboxed(desktopID string, profile string) *dbus.Error {
+	entry, err := m.getDockedAppEntryByDesktopFilePath(desktopID)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+
+	entry.PropsMu.Lock()
+	defer entry.PropsMu.Unlock()
+
+	oldProfile := entry.SandboxProfile
+	oldSandboxed := entry.IsSandboxed
+
+	if profile == "" {
+		entry.setPropIsSandboxed(false)
+		entry.setPropSandboxProfile("")
+	} else {
+		if !bwrapAvailable() {
+			// buildSandboxWrapperScript falls back to an unconfined wrapper
+			// when bwrap is missing, which would leave IsSandboxed=true
+			// lying about the app's actual confinement state; fail instead.
+			return dbusutil.ToError(fmt.Errorf("cannot sandbox: %s is not installed", defaultSandboxCmd))
+		}
+		if _, err := loadSandboxProfile(profile); err != nil {
+			return dbusutil.ToError(err)
+		}
+		entry.setPropSandboxProfile(profile)
+		entry.setPropIsSandboxed(true)
+	}
+
+	if err := regenerateSandboxWrapper(m.sessionBus, entry); err != nil {
+		// The wrapper on disk was never updated to match, so roll the
+		// properties back rather than leave them claiming a confinement
+		// state that was never actually applied.
+		entry.setPropSandboxProfile(oldProfile)
+		entry.setPropIsSandboxed(oldSandboxed)
+		return dbusutil.ToError(err)
+	}
+	return nil
+}
+
+// regenerateSandboxWrapper makes an entry's on-disk launch wrapper match its
+// current sandbox configuration. Most docked entries were pinned from an
+// already-installed .desktop file and never went through
+// createScratchDesktopFileWithAppEntry's scratch-writing path, so the first
+// time sandboxing is turned on for one there is no wrapper script to
+// rewrite yet: convertToScratchSandboxEntry creates the scratch copy and
+// wrapper and repoints entry.appInfo at it. Once an entry has a scratch
+// wrapper, later profile changes (including turning sandboxing back off)
+// just rewrite that script in place.
+func regenerateSandboxWrapper(sessionBus *dbus.Conn, entry *AppEntry) error {
+	if entry.appInfo == nil {
+		return nil
+	}
+	if !isFileInDir(entry.appInfo.GetFileName(), scratchDir) {
+		if !entry.IsSandboxed {
+			// Never converted to a scratch entry and sandboxing isn't being
+			// requested: nothing to materialize.
+			return nil
+		}
+		return convertToScratchSandboxEntry(sessionBus, entry)
+	}
+
+	scriptFile := trimDesktopExt(entry.appInfo.GetFileName()) + ".sh"
+	if !dutils.IsFileExist(scriptFile) {
+		return nil
+	}
+
+	scriptContent := entry.getExec(false)
+	if entry.IsSandboxed && entry.SandboxProfile != "" {
+		profile, err := loadSandboxProfile(entry.SandboxProfile)
+		if err != nil {
+			logger.Warning("regenerateSandboxWrapper: failed to load sandbox profile, launching unconfined:", err)
+		} else {
+			scriptContent = buildSandboxWrapperScript(sessionBus, profile, scriptContent, entry.Id)
+		}
+	}
+	// #nosec G306
+	return ioutil.WriteFile(scriptFile, []byte(scriptContent), 0744)
+}
+
+// convertToScratchSandboxEntry copies an installed entry's .desktop file
+// into scratchDir with its Exec= line rewritten to invoke a generated bwrap
+// wrapper script, then repoints entry.appInfo at the copy. This is the step
+// needScratchDesktop's "already installed" early-out skips for ordinary
+// pinned apps, and it's the only way to sandbox one afterwards: the
+// original .desktop lives under a system directory dock doesn't own, so
+// there is nowhere to drop a wrapper script without making a scratch copy
+// first.
+func convertToScratchSandboxEntry(sessionBus *dbus.Conn, entry *AppEntry) error {
+	// #nosec G301
+	if err := os.MkdirAll(scratchDir, 0755); err != nil {
+		return err
+	}
+
+	srcDesktop := entry.appInfo.GetFileName()
+	content, err := ioutil.ReadFile(srcDesktop)
+	if err != nil {
+		return err
+	}
+
+	scriptContent := entry.getExec(false)
+	profile, err := loadSandboxProfile(entry.SandboxProfile)
+	if err != nil {
+		logger.Warning("convertToScratchSandboxEntry: failed to load sandbox profile, launching unconfined:", err)
+	} else {
+		scriptContent = buildSandboxWrapperScript(sessionBus, profile, scriptContent, entry.Id)
+	}
+
+	appId := entry.appInfo.innerId
+	scriptFile := filepath.Join(scratchDir, appId+".sh")
+	// #nosec G306
+	if err := ioutil.WriteFile(scriptFile, []byte(scriptContent), 0744); err != nil {
+		return err
+	}
+
+	newDesktop := filepath.Join(scratchDir, appId+".desktop")
+	newContent := rewriteDesktopExec(string(content), scriptFile+" %U")
+	// #nosec G306
+	if err := ioutil.WriteFile(newDesktop, []byte(newContent), 0644); err != nil {
+		return err
+	}
+
+	entry.setAppInfo(NewAppInfoFromFile(newDesktop))
+	return nil
+}
+
+// rewriteDesktopExec replaces the Exec= line of a .desktop file's content
+// with newExec, leaving Name=, Icon= and every other line untouched.
+func rewriteDesktopExec(content, newExec string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "Exec=") {
+			lines[i] = "Exec=" + newExec
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubBwrapOnPath puts a fake, always-succeeding "bwrap" executable at the
+// front of PATH so bwrapAvailable() reports true regardless of whether the
+// real binary is installed in the test environment.
+func stubBwrapOnPath(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	stub := filepath.Join(dir, "bwrap")
+	if err := os.WriteFile(stub, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestShQuotePreventsExpansion(t *testing.T) {
+	cases := []string{
+		`$(rm -rf ~)`,
+		"`touch /tmp/pwned`",
+		`$HOME`,
+		`it's a test`,
+		`plain`,
+	}
+	for _, in := range cases {
+		quoted := shQuote(in)
+		out, err := exec.Command("sh", "-c", "printf %s "+quoted).CombinedOutput()
+		if err != nil {
+			t.Fatalf("shQuote(%q) produced invalid shell syntax %q: %v", in, quoted, err)
+		}
+		if string(out) != in {
+			t.Errorf("shQuote(%q) round-tripped to %q, want %q", in, string(out), in)
+		}
+	}
+}
+
+func TestBuildBwrapArgsBindsDisplaySockets(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+
+	profile := &SandboxProfile{}
+	args := profile.buildBwrapArgs("echo hi")
+
+	joined := strings.Join(args, "\x00")
+	if !strings.Contains(joined, "/run/user/1000") {
+		t.Errorf("buildBwrapArgs should bind XDG_RUNTIME_DIR by default, got %v", args)
+	}
+	if !strings.Contains(joined, "--unshare-net") {
+		t.Errorf("buildBwrapArgs should unshare network by default, got %v", args)
+	}
+}
+
+func TestBuildSandboxWrapperScriptEscapesInnerCmd(t *testing.T) {
+	stubBwrapOnPath(t)
+
+	profile := &SandboxProfile{}
+	script := buildSandboxWrapperScript(nil, profile, "echo $(id)", "test-app")
+
+	if !strings.Contains(script, shQuote("echo $(id)")) {
+		t.Fatalf("expected innerCmd to be single-quoted in the generated script, got:\n%s", script)
+	}
+}
+
+func TestRewriteDesktopExecReplacesOnlyExecLine(t *testing.T) {
+	content := "[Desktop Entry]\nName=Test App\nExec=/usr/bin/test-app --flag\nIcon=test-app\n"
+
+	got := rewriteDesktopExec(content, "/scratch/test-app.sh %U")
+
+	want := "[Desktop Entry]\nName=Test App\nExec=/scratch/test-app.sh %U\nIcon=test-app\n"
+	if got != want {
+		t.Errorf("rewriteDesktopExec(%q) = %q, want %q", content, got, want)
+	}
+}
+
+func TestRewriteDesktopExecNoExecLine(t *testing.T) {
+	content := "[Desktop Entry]\nName=Test App\n"
+
+	got := rewriteDesktopExec(content, "/scratch/test-app.sh %U")
+
+	if got != content {
+		t.Errorf("rewriteDesktopExec with no Exec= line should leave content untouched, got %q, want %q", got, content)
+	}
+}
+
+func TestDockAppSandboxedRollsBackOnWrapperFailure(t *testing.T) {
+	withScratchDir(t)
+	stubBwrapOnPath(t)
+
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("HOME", configDir)
+	profileDir := filepath.Join(configDir, "deepin/dde-daemon/dock/sandbox")
+	// #nosec G301
+	if err := os.MkdirAll(profileDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(profileDir, "default.yaml"), []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	installDir := t.TempDir()
+	srcDesktop := filepath.Join(installDir, "installed.desktop")
+	if err := os.WriteFile(srcDesktop, []byte("[Desktop Entry]\nName=Installed\nExec=true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := &AppEntry{Id: "installed-app", IsDocked: true}
+	entry.setAppInfo(NewAppInfoFromFile(srcDesktop))
+
+	// Delete the source .desktop file out from under the already-constructed
+	// appInfo so convertToScratchSandboxEntry's read of it fails, forcing
+	// regenerateSandboxWrapper to return an error.
+	if err := os.Remove(srcDesktop); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Manager{Entries: AppEntries{entry}}
+
+	if dbusErr := m.DockAppSandboxed(srcDesktop, "default"); dbusErr == nil {
+		t.Fatal("DockAppSandboxed should fail when regenerateSandboxWrapper can't read the source .desktop file")
+	}
+
+	if entry.IsSandboxed || entry.SandboxProfile != "" {
+		t.Errorf("DockAppSandboxed left IsSandboxed=%v SandboxProfile=%q after a failed regenerateSandboxWrapper, want rollback to the prior unsandboxed state",
+			entry.IsSandboxed, entry.SandboxProfile)
+	}
+}
@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2018 - 2022 UnionTech Software Technology Co., Ltd.
+//
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dock
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus"
+)
+
+// AppEntries is the live collection of AppEntry the Manager tracks.
+type AppEntries []*AppEntry
+
+// FilterDocked returns the subset of entries currently pinned to the dock.
+func (entries AppEntries) FilterDocked() AppEntries {
+	var docked AppEntries
+	for _, entry := range entries {
+		if entry.IsDocked {
+			docked = append(docked, entry)
+		}
+	}
+	return docked
+}
+
+// getByInnerId returns the running entry matching innerId, or nil.
+func (entries AppEntries) getByInnerId(innerId string) *AppEntry {
+	for _, entry := range entries {
+		if entry.innerId == innerId {
+			return entry
+		}
+	}
+	return nil
+}
+
+// stringListProp is a minimal settable property, standing in for the
+// gsettings-backed DockedApps dbusutil export.
+type stringListProp struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (p *stringListProp) Set(v []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.list = v
+}
+
+func (p *stringListProp) Get() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.list
+}
+
+// powerPolicyMapProp is a minimal settable property, standing in for the
+// gsettings-backed DockedAppPowerPolicies dbusutil export.
+type powerPolicyMapProp struct {
+	mu       sync.Mutex
+	policies map[string]PowerPolicy
+}
+
+func (p *powerPolicyMapProp) Set(v map[string]PowerPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.policies = v
+}
+
+func (p *powerPolicyMapProp) Get() map[string]PowerPolicy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.policies
+}
+
+// Manager is the dock daemon's D-Bus-exported entry point. Only the fields
+// touched by the scratch-file, sandbox, export/import, icon-resolver, power
+// policy and audit-log code paths are declared here.
+type Manager struct {
+	Entries                AppEntries
+	DockedApps             *stringListProp
+	DockedAppPowerPolicies *powerPolicyMapProp
+
+	sessionBus *dbus.Conn
+	systemBus  *dbus.Conn
+
+	powerBridgeOnce sync.Once
+	powerBridge     *dockPowerBridge
+}
@@ -53,6 +53,15 @@ func newHelper(systemBus, sessionBus *dbus.Conn) (*Helper, error) {
 	return h, nil
 }
 
+// NewHelper is the exported entry point for packages outside session/power
+// that need a subset of Helper's D-Bus proxies (dock's power-policy bridge,
+// for instance) instead of dialing their own. Each call goes through the
+// same init path and returns a separate Helper with its own proxies (and X
+// connection) on the given buses.
+func NewHelper(systemBus, sessionBus *dbus.Conn) (*Helper, error) {
+	return newHelper(systemBus, sessionBus)
+}
+
 func (h *Helper) init(sysBus, sessionBus *dbus.Conn) error {
 	var err error
 
@@ -90,6 +99,12 @@ func (h *Helper) initSignalExt(systemSigLoop, sessionSigLoop *dbusutil.SignalLoo
 	h.Display.InitSignalExt(sessionSigLoop, true)
 }
 
+// InitSignalExt is the exported counterpart of initSignalExt for callers
+// outside this package that construct a Helper via NewHelper.
+func (h *Helper) InitSignalExt(systemSigLoop, sessionSigLoop *dbusutil.SignalLoop) {
+	h.initSignalExt(systemSigLoop, sessionSigLoop)
+}
+
 func (h *Helper) Destroy() {
 	h.SysDBusDaemon.RemoveHandler(proxy.RemoveAllHandlers)
 	h.LoginManager.RemoveHandler(proxy.RemoveAllHandlers)